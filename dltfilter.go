@@ -0,0 +1,152 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"time"
+)
+
+
+// predicate reports whether a message passes one filter criterion.
+type predicate func(msg Message) bool
+
+
+func toSet(values stringList) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		set[v] = true
+	}
+	return set
+}
+
+
+func matchAppid(m Message, apps map[string]bool) bool {
+	return m.sh.ueh && apps[strings.Trim(m.eh.apid, "\x00")]
+}
+
+
+func matchCtid(m Message, ctids map[string]bool) bool {
+	return m.sh.ueh && ctids[strings.Trim(m.eh.ctid, "\x00")]
+}
+
+
+func matchEcu(m Message, ecus map[string]bool) bool {
+	return ecus[m.sh.ecu]
+}
+
+
+// typeName renders an mstp value the way -t expects it to be spelled.
+func typeName(mstp int) string {
+	switch mstp {
+	case DLT_TYPE_LOG:
+		return "log"
+	case DLT_TYPE_APP_TRACE:
+		return "trace"
+	case DLT_TYPE_NW_TRACE:
+		return "network"
+	case DLT_TYPE_CONTROL:
+		return "control"
+	}
+	return ""
+}
+
+
+func matchType(m Message, types map[string]bool) bool {
+	return m.sh.ueh && types[typeName(m.eh.mstp)]
+}
+
+
+// matchLevel implements "-l <=level>" using the DLT log-level encoding
+// carried in mtin when mstp==DLT_TYPE_LOG: 1=FATAL .. 6=VERBOSE.
+func matchLevel(m Message, level int) bool {
+	return m.sh.ueh && m.eh.mstp == DLT_TYPE_LOG && m.eh.mtin >= 1 && m.eh.mtin <= level
+}
+
+
+func matchTimeRange(m Message, since, until time.Time) bool {
+	t := m.st.timestamp
+	if !since.IsZero() && t.Before(since) {
+		return false
+	}
+	if !until.IsZero() && t.After(until) {
+		return false
+	}
+	return true
+}
+
+
+func matchGrep(m Message, re *regexp.Regexp) bool {
+	return re.MatchString(renderArgs(m.pl.args))
+}
+
+
+// filterOptions holds the parsed -a/-c/-e/-t/-l/-since/-until/-grep flags
+// that buildFilter combines into a single predicate.
+type filterOptions struct {
+	apids stringList
+	ctids stringList
+	ecus  stringList
+	types stringList
+	level int
+	since time.Time
+	until time.Time
+	grep  *regexp.Regexp
+}
+
+
+// buildFilter combines every configured criterion into one predicate that
+// short-circuits on the first failing check.
+func buildFilter(opts filterOptions) predicate {
+	var preds []predicate
+
+	if len(opts.apids) > 0 {
+		apps := toSet(opts.apids)
+		preds = append(preds, func(m Message) bool { return matchAppid(m, apps) })
+	}
+	if len(opts.ctids) > 0 {
+		ctids := toSet(opts.ctids)
+		preds = append(preds, func(m Message) bool { return matchCtid(m, ctids) })
+	}
+	if len(opts.ecus) > 0 {
+		ecus := toSet(opts.ecus)
+		preds = append(preds, func(m Message) bool { return matchEcu(m, ecus) })
+	}
+	if len(opts.types) > 0 {
+		types := toSet(opts.types)
+		preds = append(preds, func(m Message) bool { return matchType(m, types) })
+	}
+	if opts.level > 0 {
+		preds = append(preds, func(m Message) bool { return matchLevel(m, opts.level) })
+	}
+	if !opts.since.IsZero() || !opts.until.IsZero() {
+		preds = append(preds, func(m Message) bool { return matchTimeRange(m, opts.since, opts.until) })
+	}
+	if opts.grep != nil {
+		preds = append(preds, func(m Message) bool { return matchGrep(m, opts.grep) })
+	}
+
+	return func(m Message) bool {
+		for _, p := range preds {
+			if !p(m) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+
+// filterMessages applies match to every message, inverting the result when
+// negate (-not) is set.
+func filterMessages(msg <-chan Message, match predicate, negate bool) (<-chan Message) {
+	out := make(chan Message)
+	go func () {
+		for m := range msg {
+			if match(m) != negate {
+				out <- m
+			}
+		}
+		close(out)
+	}()
+	return out
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"regexp"
+	"testing"
+	"time"
+)
+
+func filterSampleMessage() Message {
+	return Message{
+		st: StorageHeader{timestamp: time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)},
+		sh: StandardHeader{ueh: true, ecu: "ECU1"},
+		eh: ExtendedHeader{mstp: DLT_TYPE_LOG, mtin: 3, apid: "APP1", ctid: "CTX1"},
+		pl: Payload{args: []interface{}{"hello world"}},
+	}
+}
+
+func TestBuildFilterNoCriteria(t *testing.T) {
+	f := buildFilter(filterOptions{})
+	if !f(filterSampleMessage()) {
+		t.Fatal("buildFilter(no criteria) rejected a message, want it to pass everything")
+	}
+}
+
+func TestBuildFilterAppidCtidEcu(t *testing.T) {
+	msg := filterSampleMessage()
+
+	match := buildFilter(filterOptions{apids: stringList{"APP1"}, ctids: stringList{"CTX1"}, ecus: stringList{"ECU1"}})
+	if !match(msg) {
+		t.Fatal("buildFilter() rejected a message matching apid/ctid/ecu")
+	}
+
+	noMatch := buildFilter(filterOptions{apids: stringList{"OTHER"}})
+	if noMatch(msg) {
+		t.Fatal("buildFilter() accepted a message with the wrong apid")
+	}
+}
+
+func TestBuildFilterLevel(t *testing.T) {
+	msg := filterSampleMessage() // mtin == 3
+
+	if !buildFilter(filterOptions{level: 3})(msg) {
+		t.Fatal("buildFilter(level=3) rejected a level-3 message")
+	}
+	if buildFilter(filterOptions{level: 2})(msg) {
+		t.Fatal("buildFilter(level=2) accepted a level-3 message")
+	}
+}
+
+func TestBuildFilterTimeRange(t *testing.T) {
+	msg := filterSampleMessage()
+
+	inRange := buildFilter(filterOptions{
+		since: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		until: time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC),
+	})
+	if !inRange(msg) {
+		t.Fatal("buildFilter(time range) rejected a message inside the range")
+	}
+
+	outOfRange := buildFilter(filterOptions{until: time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)})
+	if outOfRange(msg) {
+		t.Fatal("buildFilter(time range) accepted a message before -until")
+	}
+}
+
+func TestBuildFilterGrep(t *testing.T) {
+	msg := filterSampleMessage()
+
+	if !buildFilter(filterOptions{grep: regexp.MustCompile("world")})(msg) {
+		t.Fatal("buildFilter(grep) rejected a matching payload")
+	}
+	if buildFilter(filterOptions{grep: regexp.MustCompile("nope")})(msg) {
+		t.Fatal("buildFilter(grep) accepted a non-matching payload")
+	}
+}
+
+func TestFilterMessagesNegate(t *testing.T) {
+	in := make(chan Message, 1)
+	in <- filterSampleMessage()
+	close(in)
+
+	alwaysTrue := func(Message) bool { return true }
+	out := filterMessages(in, alwaysTrue, true)
+	if _, ok := <-out; ok {
+		t.Fatal("filterMessages(negate=true) passed a message that matched, want it dropped")
+	}
+}
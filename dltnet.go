@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"net"
+	"time"
+)
+
+
+const (
+	dltServiceIDGetLogInfo      = 0x03
+	dltServiceIDRegisterContext = 0x13
+)
+
+
+func controlRequest(id uint32) []byte {
+	payload := make([]byte, 4)
+	binary.LittleEndian.PutUint32(payload, id)
+
+	eh := make([]byte, 10)
+	eh[0] = DLT_TYPE_CONTROL << 1 // non-verbose control message
+	eh[1] = 1
+
+	hdr := make([]byte, 4)
+	hdr[0] = UEH
+	binary.BigEndian.PutUint16(hdr[2:4], uint16(len(hdr)+len(eh)+len(payload)))
+
+	frame := append(hdr, eh...)
+	return append(frame, payload...)
+}
+
+
+func dialDLT(addr string) (net.Conn, error) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range []uint32{dltServiceIDGetLogInfo, dltServiceIDRegisterContext} {
+		if _, err := conn.Write(controlRequest(id)); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+
+// splitNetMessage is the bufio.SplitFunc for the daemon's wire format: unlike
+// a .dlt file, there is no storage header in front of each frame.
+func splitNetMessage(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if len(data) < 4 {
+		return 0, nil, nil
+	}
+
+	mlen := binary.BigEndian.Uint16(data[2:4])
+	if mlen < 4 {
+		return 0, nil, fmt.Errorf("dlt: invalid frame length %d", mlen)
+	}
+	advance = int(mlen)
+	if len(data) < advance {
+		return 0, nil, nil
+	}
+
+	if atEOF {
+		err = bufio.ErrFinalToken
+	}
+	return advance, data[:advance], err
+}
+
+
+// synthesizeStorageHeader stands in for the storage header a .dlt file would
+// have, which the daemon never puts on the wire.
+func synthesizeStorageHeader(t time.Time) []byte {
+	hdr := make([]byte, 16)
+	copy(hdr[:4], "DLT\x01")
+	binary.LittleEndian.PutUint32(hdr[4:8], uint32(t.Unix()))
+	binary.LittleEndian.PutUint32(hdr[8:12], uint32(t.Nanosecond()/1000))
+	return hdr
+}
+
+
+// readLiveMessages streams frames from a running dlt-daemon at addr. follow
+// keeps reading after the daemon closes the connection; reconnect redials
+// with exponential backoff instead of giving up on a failed dial.
+func readLiveMessages(addr string, follow bool, reconnect bool) <-chan []byte {
+	out := make(chan []byte)
+	go func () {
+		defer close(out)
+
+		backoff := time.Second
+		const maxBackoff = 30 * time.Second
+
+		for {
+			conn, err := dialDLT(addr)
+			if err != nil {
+				if !reconnect {
+					log.Fatalln(err)
+				}
+				log.Printf("dlt: %v, reconnecting in %s", err, backoff)
+				time.Sleep(backoff)
+				if backoff *= 2; backoff > maxBackoff {
+					backoff = maxBackoff
+				}
+				continue
+			}
+			backoff = time.Second
+
+			scn := bufio.NewScanner(conn)
+			scn.Buffer(make([]byte, 64*1024), 1<<20)
+			scn.Split(splitNetMessage)
+			for scn.Scan() {
+				out <- append(synthesizeStorageHeader(time.Now()), scn.Bytes()...)
+			}
+			conn.Close()
+
+			if err := scn.Err(); err != nil {
+				log.Printf("dlt: %v", err)
+			}
+			if !follow {
+				return
+			}
+		}
+	}()
+	return out
+}
+
+
+// ringBuffer keeps only the last N messages handed to add, overwriting the
+// oldest entry once full.
+type ringBuffer struct {
+	buf   []Message
+	next  int
+	count int
+}
+
+func newRingBuffer(n int) *ringBuffer {
+	return &ringBuffer{buf: make([]Message, n)}
+}
+
+func (r *ringBuffer) add(m Message) {
+	r.buf[r.next] = m
+	r.next = (r.next + 1) % len(r.buf)
+	if r.count < len(r.buf) {
+		r.count++
+	}
+}
+
+func (r *ringBuffer) messages() []Message {
+	start := 0
+	if r.count == len(r.buf) {
+		start = r.next
+	}
+
+	out := make([]Message, r.count)
+	for i := range out {
+		out[i] = r.buf[(start+i)%len(r.buf)]
+	}
+	return out
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func netFrame(mlen uint16, extra int) []byte {
+	data := make([]byte, 4+extra)
+	binary.BigEndian.PutUint16(data[2:4], mlen)
+	return data
+}
+
+func TestSplitNetMessageNeedsMore(t *testing.T) {
+	if advance, token, err := splitNetMessage([]byte{1, 2, 3}, false); advance != 0 || token != nil || err != nil {
+		t.Fatalf("splitNetMessage(short header) = %d, %v, %v; want 0, nil, nil", advance, token, err)
+	}
+
+	data := netFrame(10, 0) // mlen says 10 bytes, only 4 buffered
+	if advance, token, err := splitNetMessage(data, false); advance != 0 || token != nil || err != nil {
+		t.Fatalf("splitNetMessage(incomplete frame) = %d, %v, %v; want 0, nil, nil", advance, token, err)
+	}
+}
+
+func TestSplitNetMessageValidFrame(t *testing.T) {
+	data := netFrame(6, 2) // 4-byte header + 2 bytes payload
+	advance, token, err := splitNetMessage(data, false)
+	if err != nil {
+		t.Fatalf("splitNetMessage() error = %v", err)
+	}
+	if advance != 6 || len(token) != 6 {
+		t.Fatalf("splitNetMessage() = %d, %d bytes; want 6, 6", advance, len(token))
+	}
+}
+
+func TestSplitNetMessageRejectsShortFrame(t *testing.T) {
+	for _, mlen := range []uint16{0, 1, 2, 3} {
+		data := netFrame(mlen, 0)
+		advance, token, err := splitNetMessage(data, false)
+		if err == nil {
+			t.Errorf("splitNetMessage(mlen=%d) error = nil, want a protocol error", mlen)
+		}
+		if advance != 0 || token != nil {
+			t.Errorf("splitNetMessage(mlen=%d) = %d, %v; want 0, nil", mlen, advance, token)
+		}
+	}
+}
+
+func TestRingBuffer(t *testing.T) {
+	r := newRingBuffer(3)
+	for i := 0; i < 5; i++ {
+		r.add(Message{sh: StandardHeader{mcnt: byte(i)}})
+	}
+
+	got := r.messages()
+	if len(got) != 3 {
+		t.Fatalf("messages() returned %d entries, want 3", len(got))
+	}
+	for i, want := range []byte{2, 3, 4} {
+		if got[i].sh.mcnt != want {
+			t.Errorf("messages()[%d].sh.mcnt = %d, want %d", i, got[i].sh.mcnt, want)
+		}
+	}
+}
@@ -34,7 +34,14 @@ import (
 	"strconv"
 	"time"
 	"flag"
+	"io"
 	"path/filepath"
+	"regexp"
+	"math"
+	"math/big"
+	"runtime"
+
+	"github.com/r0mk1/dltp/fibex"
 )
 
 
@@ -50,13 +57,24 @@ const (
 	VERB = 1 << 0
 )
 
+const (
+	DLT_TYPE_LOG = iota
+	DLT_TYPE_APP_TRACE
+	DLT_TYPE_NW_TRACE
+	DLT_TYPE_CONTROL
+)
+
 const (
 	BOOL = 1 << 4
 	SINT = 1 << 5
 	UINT = 1 << 6
+	FLOA = 1 << 7
+	ARAY = 1 << 8
 	STRG = 1 << 9
+	RAWD = 1 << 10
 	VARI = 1 << 11
 	FIXP = 1 << 12
+	TRAI = 1 << 13
 	SCOD = 1 << 15
 )
 
@@ -88,6 +106,7 @@ type StandardHeader struct {
 	mcnt byte
 	len  uint16
 	tmsp float32
+	ecu  string
 
 	size int
 }
@@ -106,6 +125,21 @@ type Payload struct {
 	args []interface{}
 }
 
+// Variable is the decoded value of a VARI-tagged argument together with the
+// name/unit strings the producer attached to it.
+type Variable struct {
+	name  string
+	unit  string
+	value interface{}
+}
+
+func (v Variable) String() string {
+	if v.unit != "" {
+		return fmt.Sprintf("%s=%v%s", v.name, v.value, v.unit)
+	}
+	return fmt.Sprintf("%s=%v", v.name, v.value)
+}
+
 type Message struct {
 	st StorageHeader
 	sh StandardHeader
@@ -113,6 +147,10 @@ type Message struct {
 	pl Payload
 
 	verbose bool
+
+	raw []byte // the exact bytes the message was parsed from, storage header included
+
+	release func() // returns msg.raw's backing buffer to the parallel pipeline's pool, if any
 }
 
 
@@ -136,6 +174,7 @@ func (h *StandardHeader) Parse(data []byte) {
 
 	h.size = 4
 	if h.weid {
+		h.ecu = string(bytes.TrimRight(data[h.size:h.size+4], "\x00"))
 		h.size += 4
 	}
 	if h.wsid {
@@ -161,7 +200,70 @@ func (h *ExtendedHeader) Parse(data []byte) {
 }
 
 
-func parseBool(tinfo uint32, data []byte) (v interface{}, rest []byte) {
+func byteOrder(msbf bool) binary.ByteOrder {
+	if msbf {
+		return binary.BigEndian
+	}
+	return binary.LittleEndian
+}
+
+
+// bigEndianBytes returns data in big-endian byte order regardless of msbf,
+// so it can be handed to (*big.Int).SetBytes.
+func bigEndianBytes(data []byte, msbf bool) []byte {
+	if msbf {
+		return data
+	}
+	be := make([]byte, len(data))
+	for i, b := range data {
+		be[len(data)-1-i] = b
+	}
+	return be
+}
+
+
+func readUint128(data []byte, msbf bool) *big.Int {
+	return new(big.Int).SetBytes(bigEndianBytes(data, msbf))
+}
+
+
+func readInt128(data []byte, msbf bool) *big.Int {
+	v := readUint128(data, msbf)
+	if v.Bit(127) == 1 {
+		v.Sub(v, new(big.Int).Lsh(big.NewInt(1), 128))
+	}
+	return v
+}
+
+
+// float16ToFloat32 converts an IEEE 754 binary16 value to a float32.
+func float16ToFloat32(bits uint16) float32 {
+	sign := uint32(bits>>15) & 0x1
+	exp := uint32(bits>>10) & 0x1F
+	frac := uint32(bits) & 0x3FF
+
+	var bits32 uint32
+	switch {
+	case exp == 0 && frac == 0:
+		bits32 = sign << 31
+	case exp == 0:
+		for frac&0x400 == 0 {
+			frac <<= 1
+			exp--
+		}
+		exp++
+		frac &= 0x3FF
+		bits32 = sign<<31 | (exp+112)<<23 | frac<<13
+	case exp == 0x1F:
+		bits32 = sign<<31 | 0xFF<<23 | frac<<13
+	default:
+		bits32 = sign<<31 | (exp+112)<<23 | frac<<13
+	}
+	return math.Float32frombits(bits32)
+}
+
+
+func parseBool(tinfo uint32, msbf bool, data []byte) (v interface{}, rest []byte) {
 	val := true
 	if data[0] == 0 {
 		val = false
@@ -170,65 +272,231 @@ func parseBool(tinfo uint32, data []byte) (v interface{}, rest []byte) {
 }
 
 
-func parseSint(tinfo uint32, data []byte) (v interface{}, rest []byte) {
-	length := 1 << (tinfo & 0x0F - 1)
-	return int32(0), data[length:]
+func parseSint(tinfo uint32, msbf bool, data []byte) (v interface{}, rest []byte) {
+	order := byteOrder(msbf)
+	switch tinfo & 0x0F {
+	case 1:
+		return int32(int8(data[0])), data[1:]
+	case 2:
+		return int32(int16(order.Uint16(data[:2]))), data[2:]
+	case 3:
+		return int32(order.Uint32(data[:4])), data[4:]
+	case 4:
+		return int64(order.Uint64(data[:8])), data[8:]
+	case 5:
+		return readInt128(data[:16], msbf), data[16:]
+	}
+	log.Fatalf("parseSint: unsupported type info length 0x%x", tinfo&0x0F)
+	return nil, data
+}
+
+
+func parseUint(tinfo uint32, msbf bool, data []byte) (v interface{}, rest []byte) {
+	order := byteOrder(msbf)
+	switch tinfo & 0x0F {
+	case 1:
+		return uint32(data[0]), data[1:]
+	case 2:
+		return uint32(order.Uint16(data[:2])), data[2:]
+	case 3:
+		return order.Uint32(data[:4]), data[4:]
+	case 4:
+		return order.Uint64(data[:8]), data[8:]
+	case 5:
+		return readUint128(data[:16], msbf), data[16:]
+	}
+	log.Fatalf("parseUint: unsupported type info length 0x%x", tinfo&0x0F)
+	return nil, data
 }
 
 
-func parseUint(tinfo uint32, data []byte) (v interface{}, rest []byte) {
-	length := 1 << (tinfo & 0x0F - 1)
-	return uint32(0), data[length:]
+func parseFloat(tinfo uint32, msbf bool, data []byte) (v interface{}, rest []byte) {
+	order := byteOrder(msbf)
+	switch tinfo & 0x0F {
+	case 2:
+		return float16ToFloat32(order.Uint16(data[:2])), data[2:]
+	case 3:
+		return math.Float32frombits(order.Uint32(data[:4])), data[4:]
+	case 4:
+		return math.Float64frombits(order.Uint64(data[:8])), data[8:]
+	}
+	log.Fatalf("parseFloat: unsupported type info length 0x%x", tinfo&0x0F)
+	return nil, data
 }
 
 
-func parseString(tinfo uint32, data []byte) (v interface{}, rest []byte) {
+func parseString(tinfo uint32, msbf bool, data []byte) (v interface{}, rest []byte) {
 	length := binary.LittleEndian.Uint16(data[:2])
 	s := strconv.QuoteToGraphic(string(bytes.TrimRight(data[2:2+length], "\x00")))
 	return s[1:len(s)-1], data[2+length:] // return without quotes
 }
 
 
-func parseArg(data []byte) (arg interface{}, rest []byte) {
-	pf := map[uint32] func (ti uint32, data []byte) (interface{}, []byte) {
-		BOOL : parseBool,
-		SINT : parseSint,
-		UINT : parseUint,
-		STRG : parseString,
+func parseRaw(tinfo uint32, msbf bool, data []byte) (v interface{}, rest []byte) {
+	length := binary.LittleEndian.Uint16(data[:2])
+	return fmt.Sprintf("%X", data[2:2+length]), data[2+length:]
+}
+
+
+func parseTraceInfo(tinfo uint32, msbf bool, data []byte) (v interface{}, rest []byte) {
+	length := binary.LittleEndian.Uint16(data[:2])
+	return string(bytes.TrimRight(data[2:2+length], "\x00")), data[2+length:]
+}
+
+
+// parseVariableInfo consumes the two uint16-prefixed name/unit strings that
+// VARI prepends to the value.
+func parseVariableInfo(data []byte) (name string, unit string, rest []byte) {
+	nlen := binary.LittleEndian.Uint16(data[:2])
+	name = string(bytes.TrimRight(data[2:2+nlen], "\x00"))
+	data = data[2+nlen:]
+	ulen := binary.LittleEndian.Uint16(data[:2])
+	unit = string(bytes.TrimRight(data[2:2+ulen], "\x00"))
+	return name, unit, data[2+ulen:]
+}
+
+
+type argParseFunc func(tinfo uint32, msbf bool, data []byte) (interface{}, []byte)
+
+
+var argParsers = map[uint32]argParseFunc{
+	BOOL: parseBool,
+	SINT: parseSint,
+	UINT: parseUint,
+	FLOA: parseFloat,
+	STRG: parseString,
+	RAWD: parseRaw,
+	TRAI: parseTraceInfo,
+}
+
+
+// parseArray consumes the Number-of-dimensions/per-dimension-size header and
+// then the flat list of typed elements it describes.
+func parseArray(tinfo uint32, key uint32, msbf bool, data []byte) (v interface{}, rest []byte) {
+	order := byteOrder(msbf)
+	ndim := int(order.Uint16(data[:2]))
+	data = data[2:]
+
+	count := 1
+	for i := 0; i < ndim; i++ {
+		count *= int(order.Uint16(data[:2]))
+		data = data[2:]
+	}
+
+	fn, ok := argParsers[key]
+	if !ok {
+		log.Fatalf("parseArray: unsupported element type 0x%x", key)
+	}
+
+	elems := make([]interface{}, count)
+	for i := 0; i < count; i++ {
+		elems[i], data = fn(tinfo, msbf, data)
+	}
+	return elems, data
+}
+
+
+// parseFixedPoint consumes the quantization factor and offset that FIXP
+// prepends to the raw value and returns raw*quant + offset.
+func parseFixedPoint(tinfo uint32, key uint32, msbf bool, data []byte) (v interface{}, rest []byte) {
+	order := byteOrder(msbf)
+	quant := math.Float32frombits(order.Uint32(data[:4]))
+	data = data[4:]
+
+	var offset int64
+	if tinfo&0x0F <= 3 {
+		offset = int64(int32(order.Uint32(data[:4])))
+		data = data[4:]
+	} else {
+		offset = int64(order.Uint64(data[:8]))
+		data = data[8:]
 	}
 
+	var rv interface{}
+	switch key {
+	case SINT:
+		rv, data = parseSint(tinfo, msbf, data)
+	case UINT:
+		rv, data = parseUint(tinfo, msbf, data)
+	default:
+		log.Fatalf("parseFixedPoint: unsupported base type 0x%x", key)
+	}
+
+	var raw float64
+	switch n := rv.(type) {
+	case int32:
+		raw = float64(n)
+	case uint32:
+		raw = float64(n)
+	case int64:
+		raw = float64(n)
+	case uint64:
+		raw = float64(n)
+	case *big.Int:
+		raw, _ = new(big.Float).SetInt(n).Float64()
+	}
+
+	return raw*float64(quant) + float64(offset), data
+}
+
+
+func parseArg(msbf bool, data []byte) (arg interface{}, rest []byte) {
 	typeInfo := binary.LittleEndian.Uint32(data[:4])
-	if typeInfo & VARI == VARI {
-		log.Fatal("parseArg: VARI parsing isn't implemented")
+	data = data[4:]
+
+	var name, unit string
+	hasVari := typeInfo&VARI == VARI
+	if hasVari {
+		name, unit, data = parseVariableInfo(data)
 	}
-	if typeInfo & FIXP == FIXP {
-		log.Fatal("parseArg: FIXP parsing isn't implemented")
+
+	key := typeInfo & (BOOL | SINT | UINT | FLOA | STRG | RAWD | TRAI)
+
+	var v interface{}
+	switch {
+	case typeInfo&ARAY == ARAY:
+		v, data = parseArray(typeInfo, key, msbf, data)
+	case typeInfo&FIXP == FIXP:
+		v, data = parseFixedPoint(typeInfo, key, msbf, data)
+	case key != 0:
+		v, data = argParsers[key](typeInfo, msbf, data)
+	default:
+		return data, data
 	}
 
-	key := typeInfo & (BOOL | SINT | UINT | STRG)
-	if key != 0 {
-		return pf[key](typeInfo, data[4:])
+	if hasVari {
+		return Variable{name: name, unit: unit, value: v}, data
 	}
-	return data, data
+	return v, data
 }
 
 
-func (p *Payload) Parse(verbose bool, noar int, data []byte) {
+func (p *Payload) Parse(verbose bool, noar int, msbf bool, apid, ctid string, fib *fibex.Description, strict bool, data []byte) {
 	if !verbose {
 		messageID := binary.LittleEndian.Uint32(data[:4])
+		if fib != nil {
+			if args, ok := fib.Decode(apid, ctid, messageID, data[4:]); ok {
+				p.args = args
+				return
+			}
+			if strict {
+				log.Fatalf("no FIBEX description for %s/%s message %d", apid, ctid, messageID)
+			}
+		}
 		p.args = []interface{} {fmt.Sprintf("<%d (%d) %q>", messageID, len(data[4:]), data[4:])}
 		return
 	}
 
 	p.args = make([]interface{}, noar)
 	for i:=0; i<noar; i++ {
-		p.args[i], data = parseArg(data)
+		p.args[i], data = parseArg(msbf, data)
 	}
 }
 
 
-func parse_message(data []byte) Message {
+func parse_message(data []byte, fib *fibex.Description, strict bool) Message {
 	var msg Message
+	msg.raw = data
 	msg.st.Parse(data[:16])
 	data = data[16:]
 	msg.sh.Parse(data)
@@ -240,34 +508,11 @@ func parse_message(data []byte) Message {
 		payloadOffset += 10
 	}
 	msg.verbose = msg.sh.ueh && msg.eh.verb
-	msg.pl.Parse(msg.verbose, noar, data[payloadOffset:])
+	msg.pl.Parse(msg.verbose, noar, msg.sh.msbf, msg.eh.apid, msg.eh.ctid, fib, strict, data[payloadOffset:])
 	return msg
 }
 
 
-func printMessage(msg Message, index int) {
-	fmt.Printf("%d\t%X %X\t%-32s\t%.4f", index, msg.sh.htyp, msg.sh.mcnt, msg.st.timestamp.Format(time.RFC3339Nano), msg.sh.tmsp)
-	verb := "n"
-	if msg.verbose {
-		verb = "v"
-	}
-	fmt.Printf("\t%s", verb)
-	if msg.sh.ueh {
-		fmt.Printf("\t%X %X\t%-4s %-4s\t(%d)", msg.eh.mstp, msg.eh.mtin,
-			strings.Trim(msg.eh.apid, "\x00"), strings.Trim(msg.eh.ctid, "\x00"), msg.eh.noar)
-	}
-	for i, v := range(msg.pl.args) {
-		if i==0 {
-			fmt.Printf("\t")
-		} else {
-			fmt.Printf(" ")
-		}
-		fmt.Printf("%v",  v)
-	}
-	fmt.Printf("\n")
-}
-
-
 func splitMessage(data []byte, atEOF bool) (advance int, token []byte, err error) {
 	if len(data) < 16 + 4 {
 		return 0, nil, nil
@@ -288,10 +533,10 @@ func splitMessage(data []byte, atEOF bool) (advance int, token []byte, err error
 }
 
 
-func readMessages(f *os.File) <-chan []byte {
+func readMessages(r io.Reader) <-chan []byte {
 	out := make(chan []byte)
 	go func () {
-		scn := bufio.NewScanner(f)
+		scn := bufio.NewScanner(r)
 		scn.Split(splitMessage)
 
 		for scn.Scan() {
@@ -307,11 +552,11 @@ func readMessages(f *os.File) <-chan []byte {
 }
 
 
-func parseMessages(buf <-chan []byte) (<-chan Message) {
+func parseMessages(buf <-chan []byte, fib *fibex.Description, strict bool) (<-chan Message) {
 	out := make(chan Message)
 	go func () {
 		for m := range buf {
-			out <- parse_message(m)
+			out <- parse_message(m, fib, strict)
 		}
 		close(out)
 	}()
@@ -319,42 +564,44 @@ func parseMessages(buf <-chan []byte) (<-chan Message) {
 }
 
 
-func match_appid(m Message, apps map[string]bool) bool {
-	if m.sh.ueh {
-		_, ok := apps[m.eh.apid]
-		return ok
-	}
-	return false
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s [options] FILE [...]\n", filepath.Base(os.Args[0]))
+	flag.PrintDefaults()
 }
 
 
-func filterMessages(msg <-chan Message, appidList stringList) (<-chan Message) {
-	out := make(chan Message)
-	apps := make(map[string]bool)
-	for _, app := range(appidList) {
-		apps[app] = true
+// parseTimeFlag parses a -since/-until value, returning the zero Time for
+// an empty string so an unset bound never matches as a real restriction.
+func parseTimeFlag(name, value string) time.Time {
+	if value == "" {
+		return time.Time{}
 	}
-	go func () {
-		for m := range msg {
-			if len(apps)==0 || match_appid(m, apps) {
-				out <- m
-			}
-		}
-		close(out)
-	}()
-	return out
-}
-
-
-func usage() {
-	fmt.Fprintf(os.Stderr, "Usage: %s [options] FILE [...]\n", filepath.Base(os.Args[0]))
-	flag.PrintDefaults()
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		log.Fatalf("-%s: %v", name, err)
+	}
+	return t
 }
 
 
 func main() {
-	var appidList stringList
-	flag.Var(&appidList, "a", "comma-separated list of the APPID to show")
+	var opts filterOptions
+	flag.Var(&opts.apids, "a", "comma-separated list of the APPID to show")
+	flag.Var(&opts.ctids, "c", "comma-separated list of the CTID to show")
+	flag.Var(&opts.ecus, "e", "comma-separated list of the ECU id to show")
+	flag.Var(&opts.types, "t", "comma-separated list of message types to show (log, trace, network, control)")
+	level := flag.Int("l", 0, "show DLT_TYPE_LOG messages at this level or more severe (1=FATAL .. 6=VERBOSE)")
+	since := flag.String("since", "", "only show messages at or after this RFC3339 timestamp")
+	until := flag.String("until", "", "only show messages at or before this RFC3339 timestamp")
+	grep := flag.String("grep", "", "only show messages whose rendered payload matches this regexp")
+	negate := flag.Bool("not", false, "invert the combined filter")
+	fibexFile := flag.String("fibex", "", "FIBEX/PRXML file describing non-verbose payloads")
+	strictFibex := flag.Bool("strict-fibex", false, "error out on non-verbose messages missing a FIBEX description")
+	follow := flag.Bool("follow", false, "keep reading from a dlt:// source after the daemon disconnects")
+	reconnect := flag.Bool("reconnect", false, "redial a dlt:// source with exponential backoff instead of giving up")
+	ringSize := flag.Int("ring", 0, "only print the last N messages of a dlt:// source, once reading stops")
+	outputFormat := flag.String("o", "text", "output format: text, jsonl, csv or dlt")
+	jobs := flag.Int("j", runtime.GOMAXPROCS(0), "parse file sources with N worker goroutines (1 for the old serial path)")
 	flag.Usage = usage
 	flag.Parse()
 
@@ -363,20 +610,82 @@ func main() {
 		os.Exit(-1)
 	}
 
-	for _, fn := range flag.Args() {
-		f, err := os.Open(fn)
+	opts.level = *level
+	opts.since = parseTimeFlag("since", *since)
+	opts.until = parseTimeFlag("until", *until)
+	if *grep != "" {
+		re, err := regexp.Compile(*grep)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		opts.grep = re
+	}
+	match := buildFilter(opts)
+
+	var fib *fibex.Description
+	if *fibexFile != "" {
+		var err error
+		fib, err = fibex.Load(*fibexFile)
 		if err != nil {
 			log.Fatalln(err)
 		}
-		defer f.Close()
+	}
+
+	w, err := newWriter(*outputFormat, os.Stdout)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	for _, fn := range flag.Args() {
+		var m <-chan Message
+		if strings.HasPrefix(fn, "dlt://") {
+			c := readLiveMessages(strings.TrimPrefix(fn, "dlt://"), *follow, *reconnect)
+			m = parseMessages(c, fib, *strictFibex)
+		} else {
+			f, err := os.Open(fn)
+			if err != nil {
+				log.Fatalln(err)
+			}
+			defer f.Close()
+
+			if *jobs > 1 {
+				m = parallelParseFile(f, *jobs, fib, *strictFibex)
+			} else {
+				m = parseMessages(readMessages(f), fib, *strictFibex)
+			}
+		}
+
+		fm := filterMessages(m, match, *negate)
+
+		if *ringSize > 0 {
+			ring := newRingBuffer(*ringSize)
+			for msg := range fm {
+				ring.add(msg)
+			}
+			for i, msg := range ring.messages() {
+				if err := w.Write(msg, i); err != nil {
+					log.Fatalln(err)
+				}
+				if msg.release != nil {
+					msg.release()
+				}
+			}
+			continue
+		}
 
-		c := readMessages(f)
-		m := parseMessages(c)
-		fm := filterMessages(m, appidList)
 		index := 0
 		for msg := range fm {
-			printMessage(msg, index)
+			if err := w.Write(msg, index); err != nil {
+				log.Fatalln(err)
+			}
+			if msg.release != nil {
+				msg.release()
+			}
 			index++
 		}
 	}
+
+	if err := w.Close(); err != nil {
+		log.Fatalln(err)
+	}
 }
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/binary"
+	"math/big"
+	"testing"
+)
+
+func TestParseSintUint(t *testing.T) {
+	data := make([]byte, 8)
+	binary.LittleEndian.PutUint64(data, 0xFFFFFFFFFFFFFFFF)
+
+	if v, rest := parseSint(4, false, data); v != int64(-1) || len(rest) != 0 {
+		t.Fatalf("parseSint(8-byte) = %v, %d bytes left; want -1, 0", v, len(rest))
+	}
+	if v, rest := parseUint(4, false, data); v != uint64(0xFFFFFFFFFFFFFFFF) || len(rest) != 0 {
+		t.Fatalf("parseUint(8-byte) = %v, %d bytes left; want max uint64, 0", v, len(rest))
+	}
+}
+
+func TestParseSintUint128(t *testing.T) {
+	data := make([]byte, 16)
+	data[0] = 1 // little-endian 1
+
+	v, rest := parseUint(5, false, data)
+	if got, ok := v.(*big.Int); !ok || got.Cmp(big.NewInt(1)) != 0 {
+		t.Fatalf("parseUint(128-bit) = %v; want 1", v)
+	}
+	if len(rest) != 0 {
+		t.Fatalf("parseUint(128-bit) left %d bytes, want 0", len(rest))
+	}
+
+	for i := range data {
+		data[i] = 0xFF // -1 in two's complement
+	}
+	v, _ = parseSint(5, false, data)
+	if got, ok := v.(*big.Int); !ok || got.Cmp(big.NewInt(-1)) != 0 {
+		t.Fatalf("parseSint(128-bit) = %v; want -1", v)
+	}
+}
+
+func TestFloat16ToFloat32(t *testing.T) {
+	cases := []struct {
+		bits uint16
+		want float32
+	}{
+		{0x3C00, 1.0},
+		{0xC000, -2.0},
+		{0x0000, 0.0},
+		{0x8000, float32(-0.0)},
+	}
+	for _, c := range cases {
+		if got := float16ToFloat32(c.bits); got != c.want {
+			t.Errorf("float16ToFloat32(%#x) = %v, want %v", c.bits, got, c.want)
+		}
+	}
+}
+
+func TestParseFloat(t *testing.T) {
+	data := make([]byte, 4)
+	binary.LittleEndian.PutUint32(data, 0x3F800000) // 1.0 as float32
+	v, rest := parseFloat(3, false, data)
+	if v != float32(1.0) || len(rest) != 0 {
+		t.Fatalf("parseFloat(32-bit) = %v, %d bytes left; want 1.0, 0", v, len(rest))
+	}
+}
+
+func TestParseRaw(t *testing.T) {
+	data := []byte{2, 0, 0xDE, 0xAD, 'x'}
+	v, rest := parseRaw(0, false, data)
+	if v != "DEAD" {
+		t.Fatalf("parseRaw() = %q, want %q", v, "DEAD")
+	}
+	if len(rest) != 1 || rest[0] != 'x' {
+		t.Fatalf("parseRaw() left %v, want one trailing byte", rest)
+	}
+}
+
+func TestParseArray(t *testing.T) {
+	// 1 dimension of 3 uint32 elements.
+	data := make([]byte, 2+2+3*4)
+	binary.LittleEndian.PutUint16(data[0:2], 1)
+	binary.LittleEndian.PutUint16(data[2:4], 3)
+	binary.LittleEndian.PutUint32(data[4:8], 1)
+	binary.LittleEndian.PutUint32(data[8:12], 2)
+	binary.LittleEndian.PutUint32(data[12:16], 3)
+
+	v, rest := parseArray(3, UINT, false, data)
+	got, ok := v.([]interface{})
+	if !ok || len(got) != 3 || got[0] != uint32(1) || got[1] != uint32(2) || got[2] != uint32(3) {
+		t.Fatalf("parseArray() = %v, want [1 2 3]", v)
+	}
+	if len(rest) != 0 {
+		t.Fatalf("parseArray() left %d bytes, want 0", len(rest))
+	}
+}
+
+func TestParseFixedPoint(t *testing.T) {
+	// quant=2.0, offset=1 (int32), raw sint32 value 3 -> 3*2+1 = 7
+	data := make([]byte, 4+4+4)
+	binary.LittleEndian.PutUint32(data[0:4], 0x40000000) // 2.0 as float32
+	binary.LittleEndian.PutUint32(data[4:8], 1)
+	binary.LittleEndian.PutUint32(data[8:12], 3)
+
+	v, rest := parseFixedPoint(3, SINT, false, data)
+	if v != 7.0 {
+		t.Fatalf("parseFixedPoint() = %v, want 7.0", v)
+	}
+	if len(rest) != 0 {
+		t.Fatalf("parseFixedPoint() left %d bytes, want 0", len(rest))
+	}
+}
+
+func TestParseVariableInfo(t *testing.T) {
+	data := []byte{3, 0, 'f', 'o', 'o', 1, 0, 'm', 'x'}
+	name, unit, rest := parseVariableInfo(data)
+	if name != "foo" || unit != "m" {
+		t.Fatalf("parseVariableInfo() = %q, %q; want %q, %q", name, unit, "foo", "m")
+	}
+	if len(rest) != 1 || rest[0] != 'x' {
+		t.Fatalf("parseVariableInfo() left %v, want one trailing byte", rest)
+	}
+}
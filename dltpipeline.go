@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bufio"
+	"container/heap"
+	"io"
+	"log"
+	"sync"
+
+	"github.com/r0mk1/dltp/fibex"
+)
+
+
+// readBatchSize amortizes per-send channel overhead across this many frames.
+const readBatchSize = 256
+
+
+var rawFrameBufPool = sync.Pool{
+	New: func() interface{} {
+		buf := make([]byte, 0, 4096)
+		return &buf
+	},
+}
+
+
+// rawFrame is one not-yet-parsed message and its byte offset in the source,
+// used by mergeOrdered to restore ordering after parallel parsing.
+type rawFrame struct {
+	offset  int64
+	data    []byte
+	release func()
+}
+
+
+// readMessagesBatched is readMessages' counterpart for the parallel pipeline:
+// frames are batched and their backing buffers come from rawFrameBufPool
+// instead of a fresh allocation per frame.
+func readMessagesBatched(r io.Reader, workers int) <-chan []rawFrame {
+	out := make(chan []rawFrame, workers)
+	go func () {
+		scn := bufio.NewScanner(r)
+		scn.Split(splitMessage)
+
+		var offset int64
+		batch := make([]rawFrame, 0, readBatchSize)
+		for scn.Scan() {
+			tok := scn.Bytes()
+
+			bufp := rawFrameBufPool.Get().(*[]byte)
+			buf := (*bufp)[:0]
+			if cap(buf) < len(tok) {
+				buf = make([]byte, 0, len(tok))
+			}
+			buf = append(buf, tok...)
+			*bufp = buf
+
+			batch = append(batch, rawFrame{
+				offset:  offset,
+				data:    buf,
+				release: func() { rawFrameBufPool.Put(bufp) },
+			})
+			offset += int64(len(tok))
+
+			if len(batch) == readBatchSize {
+				out <- batch
+				batch = make([]rawFrame, 0, readBatchSize)
+			}
+		}
+		if len(batch) > 0 {
+			out <- batch
+		}
+
+		if err := scn.Err(); err != nil {
+			log.Fatal(err)
+		}
+		close(out)
+	}()
+	return out
+}
+
+
+// offsetMessage pairs a parsed Message with the byte offset of the frame it
+// came from, so mergeOrdered can put the stream back in source order.
+type offsetMessage struct {
+	offset int64
+	msg    Message
+}
+
+
+func parseMessagesPool(batches <-chan []rawFrame, workers int, fib *fibex.Description, strict bool) <-chan []offsetMessage {
+	if workers < 1 {
+		workers = 1
+	}
+
+	out := make(chan []offsetMessage, workers)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func () {
+			defer wg.Done()
+			for batch := range batches {
+				parsed := make([]offsetMessage, len(batch))
+				for i, f := range batch {
+					msg := parse_message(f.data, fib, strict)
+					msg.release = f.release
+					parsed[i] = offsetMessage{offset: f.offset, msg: msg}
+				}
+				out <- parsed
+			}
+		}()
+	}
+	go func () {
+		wg.Wait()
+		close(out)
+	}()
+	return out
+}
+
+
+// offsetHeap is a min-heap of offsetMessage ordered by source offset.
+type offsetHeap []offsetMessage
+
+func (h offsetHeap) Len() int            { return len(h) }
+func (h offsetHeap) Less(i, j int) bool  { return h[i].offset < h[j].offset }
+func (h offsetHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *offsetHeap) Push(x interface{}) { *h = append(*h, x.(offsetMessage)) }
+
+func (h *offsetHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	*h = old[:n-1]
+	return item
+}
+
+
+// mergeOrdered restores source order after out-of-order parallel parsing,
+// buffering early arrivals in a min-heap until the next expected offset
+// shows up.
+func mergeOrdered(in <-chan []offsetMessage) <-chan Message {
+	out := make(chan Message)
+	go func () {
+		h := &offsetHeap{}
+		heap.Init(h)
+		next := int64(0)
+
+		for batch := range in {
+			for _, om := range batch {
+				heap.Push(h, om)
+			}
+			for h.Len() > 0 && (*h)[0].offset == next {
+				top := heap.Pop(h).(offsetMessage)
+				out <- top.msg
+				next += int64(len(top.msg.raw))
+			}
+		}
+		for h.Len() > 0 {
+			out <- heap.Pop(h).(offsetMessage).msg
+		}
+		close(out)
+	}()
+	return out
+}
+
+
+func parallelParseFile(r io.Reader, workers int, fib *fibex.Description, strict bool) <-chan Message {
+	batches := readMessagesBatched(r, workers)
+	parsed := parseMessagesPool(batches, workers, fib, strict)
+	return mergeOrdered(parsed)
+}
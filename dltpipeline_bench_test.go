@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"runtime"
+	"testing"
+)
+
+
+// synthFrame builds one minimal valid verbose DLT message (storage header +
+// standard header + extended header + a single UINT32 argument).
+func synthFrame(i int) []byte {
+	payload := make([]byte, 8)
+	binary.LittleEndian.PutUint32(payload[0:4], UINT|3)
+	binary.LittleEndian.PutUint32(payload[4:8], uint32(i))
+
+	eh := []byte{VERB, 1, 'A', 'P', 'P', '1', 'C', 'T', 'X', '1'}
+
+	sh := make([]byte, 4)
+	sh[0] = UEH
+	sh[1] = byte(i)
+	binary.BigEndian.PutUint16(sh[2:4], uint16(len(sh)+len(eh)+len(payload)))
+
+	st := make([]byte, 16)
+	copy(st[:4], "DLT\x01")
+	binary.LittleEndian.PutUint32(st[4:8], uint32(i))
+	copy(st[12:16], "ECU1")
+
+	frame := append(st, sh...)
+	frame = append(frame, eh...)
+	frame = append(frame, payload...)
+	return frame
+}
+
+
+// synthCapture builds n synthesized messages into a single .dlt-shaped
+// buffer, standing in for a real multi-million-message capture.
+func synthCapture(n int) []byte {
+	var buf bytes.Buffer
+	for i := 0; i < n; i++ {
+		buf.Write(synthFrame(i))
+	}
+	return buf.Bytes()
+}
+
+
+func benchMessageCount() int {
+	if testing.Short() {
+		return 10_000
+	}
+	return 2_000_000
+}
+
+
+func BenchmarkParseSerial(b *testing.B) {
+	data := synthCapture(benchMessageCount())
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		c := readMessages(bytes.NewReader(data))
+		m := parseMessages(c, nil, false)
+		for range m {
+		}
+	}
+}
+
+
+func BenchmarkParseParallel(b *testing.B) {
+	data := synthCapture(benchMessageCount())
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		m := parallelParseFile(bytes.NewReader(data), runtime.GOMAXPROCS(0), nil, false)
+		for msg := range m {
+			if msg.release != nil {
+				msg.release()
+			}
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/r0mk1/dltp/fibex"
+)
+
+
+// Writer renders the filtered message stream in one output format.
+type Writer interface {
+	Write(msg Message, index int) error
+	Close() error
+}
+
+func newWriter(format string, out io.Writer) (Writer, error) {
+	switch format {
+	case "", "text":
+		return &textWriter{out: out}, nil
+	case "jsonl":
+		return &jsonlWriter{enc: json.NewEncoder(out)}, nil
+	case "csv":
+		return newCSVWriter(out), nil
+	case "dlt":
+		return &dltWriter{out: out}, nil
+	}
+	return nil, fmt.Errorf("unknown output format %q", format)
+}
+
+
+// ---- text: the original tab-separated human format ----
+
+type textWriter struct {
+	out io.Writer
+}
+
+func (w *textWriter) Write(msg Message, index int) error {
+	fmt.Fprintf(w.out, "%d\t%X %X\t%-32s\t%.4f", index, msg.sh.htyp, msg.sh.mcnt, msg.st.timestamp.Format(time.RFC3339Nano), msg.sh.tmsp)
+	verb := "n"
+	if msg.verbose {
+		verb = "v"
+	}
+	fmt.Fprintf(w.out, "\t%s", verb)
+	if msg.sh.ueh {
+		fmt.Fprintf(w.out, "\t%X %X\t%-4s %-4s\t(%d)", msg.eh.mstp, msg.eh.mtin,
+			strings.Trim(msg.eh.apid, "\x00"), strings.Trim(msg.eh.ctid, "\x00"), msg.eh.noar)
+	}
+	for i, v := range(msg.pl.args) {
+		if i==0 {
+			fmt.Fprintf(w.out, "\t")
+		} else {
+			fmt.Fprintf(w.out, " ")
+		}
+		fmt.Fprintf(w.out, "%v", v)
+	}
+	_, err := fmt.Fprintf(w.out, "\n")
+	return err
+}
+
+func (w *textWriter) Close() error { return nil }
+
+
+// ---- jsonl: one JSON object per message ----
+
+type jsonArg struct {
+	Type  string      `json:"type"`
+	Value interface{} `json:"value"`
+	Name  string      `json:"name,omitempty"`
+	Unit  string      `json:"unit,omitempty"`
+}
+
+type jsonMessage struct {
+	Index     int       `json:"index"`
+	Timestamp time.Time `json:"timestamp"`
+	Tmsp      float32   `json:"tmsp"`
+	Mcnt      byte      `json:"mcnt"`
+	Ecu       string    `json:"ecu"`
+	Apid      string    `json:"apid"`
+	Ctid      string    `json:"ctid"`
+	Mstp      int       `json:"mstp"`
+	Mtin      int       `json:"mtin"`
+	Verbose   bool      `json:"verbose"`
+	Payload   []jsonArg `json:"payload"`
+}
+
+type jsonlWriter struct {
+	enc *json.Encoder
+}
+
+func (w *jsonlWriter) Write(msg Message, index int) error {
+	jm := jsonMessage{
+		Index:   index,
+		Timestamp: msg.st.timestamp,
+		Tmsp:    msg.sh.tmsp,
+		Mcnt:    msg.sh.mcnt,
+		Ecu:     msg.sh.ecu,
+		Verbose: msg.verbose,
+		Payload: make([]jsonArg, len(msg.pl.args)),
+	}
+	if msg.sh.ueh {
+		jm.Apid = strings.Trim(msg.eh.apid, "\x00")
+		jm.Ctid = strings.Trim(msg.eh.ctid, "\x00")
+		jm.Mstp = msg.eh.mstp
+		jm.Mtin = msg.eh.mtin
+	}
+	for i, a := range msg.pl.args {
+		jm.Payload[i] = toJSONArg(a)
+	}
+	return w.enc.Encode(jm)
+}
+
+func (w *jsonlWriter) Close() error { return nil }
+
+
+func toJSONArg(v interface{}) jsonArg {
+	switch a := v.(type) {
+	case Variable:
+		return jsonArg{Type: argTypeName(a.value), Value: a.value, Name: a.name, Unit: a.unit}
+	case fibex.Value:
+		return jsonArg{Type: argTypeName(a.Value), Value: a.Value, Name: a.Name}
+	default:
+		return jsonArg{Type: argTypeName(v), Value: v}
+	}
+}
+
+func argTypeName(v interface{}) string {
+	switch v.(type) {
+	case bool:
+		return "bool"
+	case int32, int64:
+		return "sint"
+	case uint32, uint64:
+		return "uint"
+	case *big.Int:
+		return "bignum"
+	case float32, float64:
+		return "float"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	default:
+		return "raw"
+	}
+}
+
+
+// ---- csv: headers stable, arguments flattened into one column ----
+
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func newCSVWriter(out io.Writer) *csvWriter {
+	w := csv.NewWriter(out)
+	w.Write([]string{"index", "timestamp", "tmsp", "mcnt", "ecu", "apid", "ctid", "mstp", "mtin", "verbose", "message"})
+	return &csvWriter{w: w}
+}
+
+func (w *csvWriter) Write(msg Message, index int) error {
+	record := []string{
+		strconv.Itoa(index),
+		msg.st.timestamp.Format(time.RFC3339Nano),
+		strconv.FormatFloat(float64(msg.sh.tmsp), 'f', 4, 32),
+		strconv.Itoa(int(msg.sh.mcnt)),
+		msg.sh.ecu,
+		"",
+		"",
+		"",
+		"",
+		strconv.FormatBool(msg.verbose),
+		renderArgs(msg.pl.args),
+	}
+	if msg.sh.ueh {
+		record[5] = strings.Trim(msg.eh.apid, "\x00")
+		record[6] = strings.Trim(msg.eh.ctid, "\x00")
+		record[7] = strconv.Itoa(msg.eh.mstp)
+		record[8] = strconv.Itoa(msg.eh.mtin)
+	}
+	if err := w.w.Write(record); err != nil {
+		return err
+	}
+	w.w.Flush()
+	return w.w.Error()
+}
+
+func (w *csvWriter) Close() error { return nil }
+
+func renderArgs(args []interface{}) string {
+	parts := make([]string, len(args))
+	for i, a := range args {
+		parts[i] = fmt.Sprintf("%v", a)
+	}
+	return strings.Join(parts, " ")
+}
+
+
+// ---- dlt: re-serialize the filtered stream back into a valid DLT file ----
+
+type dltWriter struct {
+	out io.Writer
+}
+
+func (w *dltWriter) Write(msg Message, index int) error {
+	_, err := w.out.Write(msg.raw)
+	return err
+}
+
+func (w *dltWriter) Close() error { return nil }
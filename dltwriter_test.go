@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func sampleMessage() Message {
+	return Message{
+		st:      StorageHeader{timestamp: time.Unix(1700000000, 0).UTC()},
+		sh:      StandardHeader{ueh: true, mcnt: 1, ecu: "ECU1"},
+		eh:      ExtendedHeader{verb: true, mstp: DLT_TYPE_LOG, mtin: 3, apid: "APP1", ctid: "CTX1"},
+		pl:      Payload{args: []interface{}{"hello", uint32(42)}},
+		verbose: true,
+		raw:     []byte{1, 2, 3},
+	}
+}
+
+func TestTextWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := newWriter("text", &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write(sampleMessage(), 0); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	if !strings.Contains(out, "APP1") || !strings.Contains(out, "hello") {
+		t.Fatalf("textWriter output = %q, missing expected fields", out)
+	}
+}
+
+func TestJSONLWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := newWriter("jsonl", &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write(sampleMessage(), 7); err != nil {
+		t.Fatal(err)
+	}
+
+	var jm jsonMessage
+	if err := json.Unmarshal(buf.Bytes(), &jm); err != nil {
+		t.Fatalf("invalid JSON output: %v", err)
+	}
+	if jm.Index != 7 || jm.Apid != "APP1" || jm.Ctid != "CTX1" || len(jm.Payload) != 2 {
+		t.Fatalf("jsonlWriter decoded = %+v, unexpected fields", jm)
+	}
+}
+
+func TestCSVWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := newWriter("csv", &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write(sampleMessage(), 0); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("csvWriter wrote %d lines, want a header and one record", len(lines))
+	}
+	if !strings.Contains(lines[1], "APP1") {
+		t.Fatalf("csvWriter record = %q, missing apid", lines[1])
+	}
+}
+
+func TestDLTWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := newWriter("dlt", &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := sampleMessage()
+	if err := w.Write(msg, 0); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), msg.raw) {
+		t.Fatalf("dltWriter wrote %v, want %v", buf.Bytes(), msg.raw)
+	}
+}
+
+func TestNewWriterUnknownFormat(t *testing.T) {
+	if _, err := newWriter("xml", &bytes.Buffer{}); err == nil {
+		t.Fatal("newWriter(\"xml\") error = nil, want an error for an unknown format")
+	}
+}
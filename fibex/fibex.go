@@ -0,0 +1,215 @@
+// Package fibex loads the subset of the FIBEX/PRXML PDU-description format
+// shipped alongside DLT ECUs that dltp needs to decode non-verbose messages:
+// for each (APID, CTID, message-id) triple it records the ordered list of
+// signals making up the payload, so a raw byte blob can be turned into the
+// same kind of typed arguments the verbose path produces.
+package fibex
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/xml"
+	"fmt"
+	"math"
+	"os"
+)
+
+
+// Value is a single decoded, named signal.
+type Value struct {
+	Name  string
+	Value interface{}
+}
+
+func (v Value) String() string {
+	return fmt.Sprintf("%s=%v", v.Name, v.Value)
+}
+
+
+// Signal describes how to decode one field of a non-verbose payload.
+type Signal struct {
+	Name       string
+	BaseType   string // "uint", "sint", "float" or "string"
+	ByteLength int
+	BigEndian  bool
+	Factor     float64
+	Offset     float64
+	Enum       map[int64]string
+}
+
+type pduKey struct {
+	apid, ctid string
+	mid        uint32
+}
+
+// Description is a loaded FIBEX file, indexed by (APID, CTID, message-id) so
+// lookups during decoding double as a cache keyed on message id.
+type Description struct {
+	signals map[pduKey][]Signal
+}
+
+
+type xmlFibex struct {
+	XMLName xml.Name `xml:"fibex"`
+	Pdus    []xmlPdu `xml:"pdus>pdu"`
+}
+
+type xmlPdu struct {
+	Apid    string      `xml:"apid,attr"`
+	Ctid    string      `xml:"ctid,attr"`
+	Mid     uint32      `xml:"mid,attr"`
+	Signals []xmlSignal `xml:"signal"`
+}
+
+type xmlSignal struct {
+	Name      string    `xml:"name,attr"`
+	Type      string    `xml:"type,attr"`
+	Length    int       `xml:"length,attr"`
+	ByteOrder string    `xml:"byteorder,attr"`
+	Factor    float64   `xml:"factor,attr"`
+	Offset    float64   `xml:"offset,attr"`
+	Enums     []xmlEnum `xml:"enum"`
+}
+
+type xmlEnum struct {
+	Value int64  `xml:"value,attr"`
+	Name  string `xml:"name,attr"`
+}
+
+
+// Load parses a FIBEX/PRXML description file.
+func Load(path string) (*Description, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var doc xmlFibex
+	if err := xml.NewDecoder(f).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("fibex: parsing %s: %w", path, err)
+	}
+
+	d := &Description{signals: make(map[pduKey][]Signal)}
+	for _, pdu := range doc.Pdus {
+		sigs := make([]Signal, len(pdu.Signals))
+		for i, s := range pdu.Signals {
+			factor := s.Factor
+			if factor == 0 {
+				factor = 1 // omitted factor/offset means an unscaled signal
+			}
+			sig := Signal{
+				Name:       s.Name,
+				BaseType:   s.Type,
+				ByteLength: s.Length / 8,
+				BigEndian:  s.ByteOrder == "big",
+				Factor:     factor,
+				Offset:     s.Offset,
+			}
+			if len(s.Enums) > 0 {
+				sig.Enum = make(map[int64]string, len(s.Enums))
+				for _, e := range s.Enums {
+					sig.Enum[e.Value] = e.Name
+				}
+			}
+			sigs[i] = sig
+		}
+		d.signals[pduKey{pdu.Apid, pdu.Ctid, pdu.Mid}] = sigs
+	}
+	return d, nil
+}
+
+
+// Decode looks up the signal list for (apid, ctid, mid) and, if found,
+// decodes data into one Value per signal. A payload shorter than the
+// signal list expects (stale FIBEX file, truncated capture) is reported
+// the same way as an unknown message id, leaving the fallback to the
+// caller rather than panicking.
+func (d *Description) Decode(apid, ctid string, mid uint32, data []byte) ([]interface{}, bool) {
+	sigs, ok := d.signals[pduKey{apid, ctid, mid}]
+	if !ok {
+		return nil, false
+	}
+
+	args := make([]interface{}, len(sigs))
+	for i, s := range sigs {
+		if len(data) < s.ByteLength {
+			return nil, false
+		}
+		args[i] = s.decode(data)
+		data = data[s.ByteLength:]
+	}
+	return args, true
+}
+
+
+func (s Signal) decode(data []byte) Value {
+	order := binary.ByteOrder(binary.LittleEndian)
+	if s.BigEndian {
+		order = binary.BigEndian
+	}
+	b := data[:s.ByteLength]
+
+	if s.BaseType == "string" {
+		return Value{Name: s.Name, Value: string(bytes.TrimRight(b, "\x00"))}
+	}
+
+	var raw float64
+	switch s.BaseType {
+	case "sint":
+		raw = float64(readSigned(order, b))
+	case "float":
+		raw = readFloat(order, b)
+	default: // "uint" and anything unrecognized
+		raw = float64(readUnsigned(order, b))
+	}
+
+	if s.Enum != nil {
+		if name, ok := s.Enum[int64(raw)]; ok {
+			return Value{Name: s.Name, Value: name}
+		}
+	}
+
+	return Value{Name: s.Name, Value: raw*s.Factor + s.Offset}
+}
+
+
+func readUnsigned(order binary.ByteOrder, b []byte) uint64 {
+	switch len(b) {
+	case 1:
+		return uint64(b[0])
+	case 2:
+		return uint64(order.Uint16(b))
+	case 4:
+		return uint64(order.Uint32(b))
+	case 8:
+		return order.Uint64(b)
+	}
+	return 0
+}
+
+
+func readSigned(order binary.ByteOrder, b []byte) int64 {
+	switch len(b) {
+	case 1:
+		return int64(int8(b[0]))
+	case 2:
+		return int64(int16(order.Uint16(b)))
+	case 4:
+		return int64(int32(order.Uint32(b)))
+	case 8:
+		return int64(order.Uint64(b))
+	}
+	return 0
+}
+
+
+func readFloat(order binary.ByteOrder, b []byte) float64 {
+	switch len(b) {
+	case 4:
+		return float64(math.Float32frombits(order.Uint32(b)))
+	case 8:
+		return math.Float64frombits(order.Uint64(b))
+	}
+	return 0
+}
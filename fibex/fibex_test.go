@@ -0,0 +1,77 @@
+package fibex
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const sampleFibex = `<?xml version="1.0"?>
+<fibex>
+	<pdus>
+		<pdu apid="APP1" ctid="CTX1" mid="1">
+			<signal name="speed" type="uint" length="16" byteorder="little" factor="0.1" offset="0"/>
+			<signal name="gear" type="sint" length="8"/>
+			<signal name="state" type="uint" length="8">
+				<enum value="0" name="OFF"/>
+				<enum value="1" name="ON"/>
+			</signal>
+		</pdu>
+	</pdus>
+</fibex>
+`
+
+func writeSample(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "sample.fibex")
+	if err := os.WriteFile(path, []byte(sampleFibex), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadAndDecode(t *testing.T) {
+	d, err := Load(writeSample(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := []byte{100, 0, 0xFE, 1}
+	args, ok := d.Decode("APP1", "CTX1", 1, data)
+	if !ok {
+		t.Fatal("Decode() = false, want true for a known PDU")
+	}
+	if len(args) != 3 {
+		t.Fatalf("Decode() returned %d args, want 3", len(args))
+	}
+
+	if args[0] != (Value{Name: "speed", Value: 10.0}) {
+		t.Errorf("args[0] = %v, want speed=10", args[0])
+	}
+	if args[1] != (Value{Name: "gear", Value: -2.0}) {
+		t.Errorf("args[1] = %v, want gear=-2", args[1])
+	}
+	if args[2] != (Value{Name: "state", Value: "ON"}) {
+		t.Errorf("args[2] = %v, want state=ON", args[2])
+	}
+}
+
+func TestDecodeUnknownPDU(t *testing.T) {
+	d, err := Load(writeSample(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := d.Decode("APP1", "CTX1", 99, []byte{0}); ok {
+		t.Fatal("Decode() = true for an unknown message id, want false")
+	}
+}
+
+func TestDecodeShortPayload(t *testing.T) {
+	d, err := Load(writeSample(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := d.Decode("APP1", "CTX1", 1, []byte{1}); ok {
+		t.Fatal("Decode() = true for a truncated payload, want false")
+	}
+}